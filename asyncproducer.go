@@ -0,0 +1,460 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+// ProducerMessage is a single message to be sent through an AsyncProducer.
+// Offset is filled in once the message has been successfully produced and is
+// only meaningful on values received from Successes().
+type ProducerMessage struct {
+	Topic     string
+	Partition int32
+	Key       []byte
+	Value     []byte
+	Offset    int64
+
+	// Metadata is not touched by the producer and is returned as-is on both
+	// the Successes and Errors channels, letting callers correlate a result
+	// back to whatever they used to build the message.
+	Metadata interface{}
+}
+
+// ProducerError is the value delivered on AsyncProducer.Errors() for a
+// message that could not be produced after all retries were exhausted.
+type ProducerError struct {
+	Msg *ProducerMessage
+	Err error
+}
+
+func (pe *ProducerError) Error() string {
+	return fmt.Sprintf("kafka: failed to produce message to %s/%d: %s", pe.Msg.Topic, pe.Msg.Partition, pe.Err)
+}
+
+// Return configures which outcome channels an AsyncProducer populates.
+// Errors is always delivered; Successes must be explicitly requested since
+// most callers have no use for it and leaving it unread would otherwise
+// deadlock the producer.
+type Return struct {
+	Successes bool
+}
+
+// Flush configures how aggressively an AsyncProducer batches messages
+// destined for the same (topic, partition) before writing them out as a
+// single proto.ProduceReq. A batch is flushed as soon as any one of the
+// three thresholds is reached.
+type Flush struct {
+	Bytes     int
+	Messages  int
+	Frequency time.Duration
+}
+
+// AsyncProducerConf configures an AsyncProducer.
+type AsyncProducerConf struct {
+	// RequiredAcks is passed through to every proto.ProduceReq; see
+	// proto.RequiredAcksNone / RequiredAcksLocal / RequiredAcksAll.
+	RequiredAcks int16
+
+	// RequestTimeout bounds how long a single produce request may take
+	// before the broker is expected to respond.
+	RequestTimeout time.Duration
+
+	Return Return
+	Flush  Flush
+
+	// RetryLimit is the number of times a topic-partition is retried after
+	// a retriable error (proto.ErrNotLeaderForPartition,
+	// proto.ErrLeaderNotAvailable, ...) before its messages are surfaced on
+	// Errors().
+	RetryLimit int
+	RetryWait  time.Duration
+
+	// MaxInFlightPerBroker bounds the number of batches a single broker
+	// dispatcher keeps unacknowledged at once. Anything above 1 can
+	// reorder retried batches relative to newer ones.
+	MaxInFlightPerBroker int
+
+	// BrokerCoolDown is how long a broker dispatcher stops accepting new
+	// batches after a produce attempt fails outright (as opposed to a
+	// per-partition error), before trying that broker again.
+	BrokerCoolDown time.Duration
+
+	Logger Logger
+}
+
+func (c *AsyncProducerConf) setDefaults() {
+	if c.Flush.Frequency <= 0 {
+		c.Flush.Frequency = 250 * time.Millisecond
+	}
+	if c.RetryLimit <= 0 {
+		c.RetryLimit = 3
+	}
+	if c.RetryWait <= 0 {
+		c.RetryWait = 200 * time.Millisecond
+	}
+	if c.MaxInFlightPerBroker <= 0 {
+		c.MaxInFlightPerBroker = 1
+	}
+	if c.BrokerCoolDown <= 0 {
+		c.BrokerCoolDown = 30 * time.Second
+	}
+	if c.Logger == nil {
+		c.Logger = &nullLogger{}
+	}
+}
+
+// AsyncProducer batches messages pushed through Input() for a single
+// connection and produces them in the background, delivering results on
+// Successes() and Errors(). Unlike the synchronous Producer, callers never
+// block on a broker round trip - they only block if the producer's internal
+// buffers are full.
+//
+// Errors() must always be drained: a caller that ignores it risks the
+// producer's internal channels filling up and blocking Input() forever.
+type AsyncProducer struct {
+	conf AsyncProducerConf
+
+	input      chan *ProducerMessage
+	successes  chan *ProducerMessage
+	errors     chan *ProducerError
+	dispatcher *brokerDispatcher
+
+	closed chan struct{}
+}
+
+// NewAsyncProducer returns a new AsyncProducer that produces messages over
+// conn. Callers must eventually call Close or AsyncClose.
+func NewAsyncProducer(conn *connection, conf AsyncProducerConf) *AsyncProducer {
+	conf.setDefaults()
+	successes := make(chan *ProducerMessage)
+	errors := make(chan *ProducerError)
+	p := &AsyncProducer{
+		conf:       conf,
+		input:      make(chan *ProducerMessage),
+		successes:  successes,
+		errors:     errors,
+		dispatcher: newBrokerDispatcher(conn, conf, successes, errors),
+		closed:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Input returns the channel messages should be sent to for asynchronous
+// production. It is closed by AsyncClose/Close and must not be sent to
+// afterwards.
+func (p *AsyncProducer) Input() chan<- *ProducerMessage { return p.input }
+
+// Successes returns the channel successfully produced messages are sent to.
+// It is never populated - so receives block until it is closed - unless
+// AsyncProducerConf.Return.Successes is set. It is closed once Close or
+// AsyncClose has fully drained the producer.
+func (p *AsyncProducer) Successes() <-chan *ProducerMessage { return p.successes }
+
+// Errors returns the channel messages that could not be produced, after
+// exhausting retries, are sent to. It must always be drained, and is closed
+// once Close or AsyncClose has fully drained the producer.
+func (p *AsyncProducer) Errors() <-chan *ProducerError { return p.errors }
+
+// run forwards incoming messages to the dispatcher and, once Input is
+// closed, waits for every in-flight batch to finish before closing
+// Successes and Errors - by then nothing can still be sending on them.
+func (p *AsyncProducer) run() {
+	for msg := range p.input {
+		p.dispatcher.input <- msg
+	}
+	p.dispatcher.close()
+	close(p.successes)
+	close(p.errors)
+	close(p.closed)
+}
+
+// AsyncClose stops accepting new input and triggers background draining of
+// already buffered messages. It returns immediately; Successes and Errors
+// are closed once draining completes.
+func (p *AsyncProducer) AsyncClose() {
+	close(p.input)
+}
+
+// Close stops accepting new input and blocks until every buffered message
+// has been produced (or failed), then closes Successes and Errors.
+func (p *AsyncProducer) Close() error {
+	p.AsyncClose()
+	<-p.closed
+	return nil
+}
+
+// topicPartition identifies a single partition of a single topic, used to
+// key per-partition request/response bookkeeping within a batch.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// brokerDispatcher batches messages destined for a single leader broker and
+// produces them as they cross one of the Flush thresholds, retrying
+// per-partition errors with a fresh attempt against the same connection.
+type brokerDispatcher struct {
+	conn  *connection
+	conf  AsyncProducerConf
+	input chan *ProducerMessage
+	sem   chan struct{}
+	wg    sync.WaitGroup
+
+	mu            sync.Mutex
+	coolDownUntil time.Time // circuit breaker: zero unless a produce attempt failed outright
+}
+
+func newBrokerDispatcher(conn *connection, conf AsyncProducerConf, successes chan *ProducerMessage, errors chan *ProducerError) *brokerDispatcher {
+	d := &brokerDispatcher{
+		conn:  conn,
+		conf:  conf,
+		input: make(chan *ProducerMessage),
+		sem:   make(chan struct{}, conf.MaxInFlightPerBroker),
+	}
+	d.wg.Add(1)
+	go d.run(successes, errors)
+	return d
+}
+
+func (d *brokerDispatcher) run(successes chan *ProducerMessage, errors chan *ProducerError) {
+	defer d.wg.Done()
+
+	batch := make([]*ProducerMessage, 0, d.conf.Flush.Messages)
+	batchBytes := 0
+	ticker := time.NewTicker(d.conf.Flush.Frequency)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		toSend := batch
+		batch = make([]*ProducerMessage, 0, d.conf.Flush.Messages)
+		batchBytes = 0
+		d.sem <- struct{}{}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer func() { <-d.sem }()
+			d.produceBatch(toSend, successes, errors)
+		}()
+	}
+
+	for {
+		select {
+		case msg, ok := <-d.input:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			batchBytes += len(msg.Key) + len(msg.Value)
+			if (d.conf.Flush.Messages > 0 && len(batch) >= d.conf.Flush.Messages) ||
+				(d.conf.Flush.Bytes > 0 && batchBytes >= d.conf.Flush.Bytes) {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (d *brokerDispatcher) close() {
+	close(d.input)
+	d.wg.Wait()
+}
+
+// circuitOpen reports whether this broker is presently in its cool-down
+// window, following a produce attempt that failed outright (as opposed to a
+// per-partition error). The breaker resets itself once the window passes,
+// so a transient failure does not black-hole this broker's traffic forever.
+func (d *brokerDispatcher) circuitOpen() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Now().Before(d.coolDownUntil)
+}
+
+func (d *brokerDispatcher) tripCircuit() {
+	d.mu.Lock()
+	d.coolDownUntil = time.Now().Add(d.conf.BrokerCoolDown)
+	d.mu.Unlock()
+}
+
+// produceBatch encodes and sends batch, grouped by topic-partition, and
+// retries only the partitions that came back with a retriable error
+// (proto.ErrNotLeaderForPartition, proto.ErrLeaderNotAvailable, ...) or were
+// missing from the response, up to RetryLimit times; a request that fails
+// outright with a retriable transport error is resent for every partition
+// still pending. Messages in partitions that succeed are delivered to
+// successes as soon as their partition's result is known, with Offset filled
+// in from the response; messages in partitions that fail for good, or that
+// never get a response at all, are delivered to errors.
+func (d *brokerDispatcher) produceBatch(batch []*ProducerMessage, successes chan *ProducerMessage, errors chan *ProducerError) {
+	if d.circuitOpen() {
+		d.deliverErrors(batch, ErrClosed, errors)
+		return
+	}
+
+	pending := groupByTopicPartition(batch)
+	var lastErr error = ErrClosed
+	failedOutright := false
+
+	for attempt := 0; len(pending) > 0 && attempt <= d.conf.RetryLimit; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.conf.RetryWait)
+		}
+
+		req := buildProduceRequest(d.conf, pending)
+		resp, err := d.conn.Produce(req)
+		if err != nil {
+			lastErr = err
+			failedOutright = true
+			if !isRetriableTransportError(err) {
+				break
+			}
+			continue
+		}
+		failedOutright = false
+
+		results := partitionResults(resp)
+		retry := make(map[topicPartition][]*ProducerMessage)
+		for tp, msgs := range pending {
+			res, ok := results[tp]
+			if !ok {
+				lastErr = fmt.Errorf("kafka: no response for %s/%d", tp.topic, tp.partition)
+				retry[tp] = msgs
+				continue
+			}
+			if res.errorCode != 0 {
+				lastErr = proto.KafkaError(res.errorCode)
+				if isRetriableProduceError(proto.KafkaError(res.errorCode)) {
+					retry[tp] = msgs
+					continue
+				}
+				d.deliverErrors(msgs, lastErr, errors)
+				continue
+			}
+			for i, msg := range msgs {
+				msg.Offset = res.baseOffset + int64(i)
+			}
+			d.deliverSuccess(msgs, successes)
+		}
+		pending = retry
+	}
+
+	if len(pending) > 0 {
+		if failedOutright {
+			d.tripCircuit()
+		}
+		for _, msgs := range pending {
+			d.deliverErrors(msgs, lastErr, errors)
+		}
+	}
+}
+
+// groupByTopicPartition preserves the per-partition message order of batch,
+// which buildProduceRequest and the offset assignment in produceBatch both
+// rely on to match a response's BaseOffset back to the messages it covers.
+func groupByTopicPartition(batch []*ProducerMessage) map[topicPartition][]*ProducerMessage {
+	grouped := make(map[topicPartition][]*ProducerMessage)
+	for _, msg := range batch {
+		tp := topicPartition{msg.Topic, msg.Partition}
+		grouped[tp] = append(grouped[tp], msg)
+	}
+	return grouped
+}
+
+func buildProduceRequest(conf AsyncProducerConf, grouped map[topicPartition][]*ProducerMessage) *proto.ProduceReq {
+	byTopic := make(map[string][]topicPartition)
+	for tp := range grouped {
+		byTopic[tp.topic] = append(byTopic[tp.topic], tp)
+	}
+
+	req := &proto.ProduceReq{
+		RequiredAcks: conf.RequiredAcks,
+		Timeout:      conf.RequestTimeout,
+	}
+	for topic, partitions := range byTopic {
+		topicReq := proto.ProduceReqTopic{Name: topic}
+		for _, tp := range partitions {
+			var messages []*proto.Message
+			for _, msg := range grouped[tp] {
+				messages = append(messages, &proto.Message{
+					Key:   msg.Key,
+					Value: msg.Value,
+				})
+			}
+			topicReq.Partitions = append(topicReq.Partitions, proto.ProduceReqPartition{
+				ID:       tp.partition,
+				Messages: messages,
+			})
+		}
+		req.Topics = append(req.Topics, topicReq)
+	}
+	return req
+}
+
+// partitionResult is the per-partition outcome of a produce attempt.
+type partitionResult struct {
+	errorCode  int16
+	baseOffset int64
+}
+
+// partitionResults indexes resp's per-partition results by topic-partition.
+func partitionResults(resp *proto.ProduceResp) map[topicPartition]partitionResult {
+	out := make(map[topicPartition]partitionResult)
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			out[topicPartition{t.Name, p.ID}] = partitionResult{
+				errorCode:  p.ErrorCode,
+				baseOffset: p.Offset,
+			}
+		}
+	}
+	return out
+}
+
+// deliverSuccess and deliverErrors send directly on the shared channels,
+// deliberately blocking the calling (wg-tracked) goroutine rather than
+// spawning an untracked one to retry later: close's wg.Wait() must see every
+// send completed before AsyncProducer.run closes successes/errors, and an
+// untracked goroutine could still be trying to send after that close.
+
+func (d *brokerDispatcher) deliverSuccess(msgs []*ProducerMessage, successes chan *ProducerMessage) {
+	if !d.conf.Return.Successes {
+		return
+	}
+	for _, msg := range msgs {
+		successes <- msg
+	}
+}
+
+func (d *brokerDispatcher) deliverErrors(msgs []*ProducerMessage, err error, errors chan *ProducerError) {
+	for _, msg := range msgs {
+		errors <- &ProducerError{Msg: msg, Err: err}
+	}
+}
+
+// isRetriableTransportError reports whether err - a transport-level failure
+// of the produce request itself, as opposed to a per-partition error coded
+// inside its response - is likely transient.
+func isRetriableTransportError(err error) bool {
+	return err != ErrClosed
+}
+
+// isRetriableProduceError reports whether a per-partition KafkaError code
+// returned inside a ProduceResp is likely to be resolved by retrying, such
+// as a stale leader during a partition reassignment.
+func isRetriableProduceError(code proto.KafkaError) bool {
+	switch code {
+	case proto.ErrNotLeaderForPartition, proto.ErrLeaderNotAvailable:
+		return true
+	default:
+		return false
+	}
+}
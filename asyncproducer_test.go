@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+func TestIsRetriableProduceError(t *testing.T) {
+	cases := []struct {
+		code proto.KafkaError
+		want bool
+	}{
+		{proto.ErrLeaderNotAvailable, true},
+		{proto.ErrNotLeaderForPartition, true},
+		{0, false},
+		{proto.KafkaError(2), false},
+	}
+	for _, c := range cases {
+		if got := isRetriableProduceError(c.code); got != c.want {
+			t.Errorf("isRetriableProduceError(%v) = %v, want %v", c.code, got, c.want)
+		}
+	}
+}
+
+func TestGroupByTopicPartitionPreservesOrder(t *testing.T) {
+	batch := []*ProducerMessage{
+		{Topic: "t", Partition: 0, Value: []byte("a")},
+		{Topic: "t", Partition: 1, Value: []byte("b")},
+		{Topic: "t", Partition: 0, Value: []byte("c")},
+	}
+	grouped := groupByTopicPartition(batch)
+
+	p0 := grouped[topicPartition{"t", 0}]
+	if len(p0) != 2 || string(p0[0].Value) != "a" || string(p0[1].Value) != "c" {
+		t.Fatalf("partition 0 messages out of order: %+v", p0)
+	}
+	p1 := grouped[topicPartition{"t", 1}]
+	if len(p1) != 1 || string(p1[0].Value) != "b" {
+		t.Fatalf("partition 1 messages wrong: %+v", p1)
+	}
+}
@@ -3,10 +3,12 @@ package kafka
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"sync"
@@ -18,6 +20,12 @@ import (
 // ErrClosed is returned as result of any request made using closed connection.
 var ErrClosed = errors.New("closed")
 
+// DefaultMaxInFlightRequests is the MaxInFlightRequests used when a
+// connection is not configured with one explicitly. It matches common
+// broker-side defaults and keeps producer ordering intact as long as
+// retries are disabled.
+const DefaultMaxInFlightRequests = 5
+
 // Low level abstraction over connection to Kafka.
 type connection struct {
 	rw     net.Conn
@@ -30,9 +38,24 @@ type connection struct {
 	stopErr     error
 	readTimeout time.Duration
 	apiVersions map[int16]proto.SupportedVersion
+	tracer      Tracer
+
+	// writec is the pipelined write queue: every request method encodes
+	// its frame and hands it to writeLoop instead of writing to rw
+	// directly, so concurrent callers never interleave partial frames on
+	// the wire and never block each other on the write syscall.
+	writec chan *writePromise
+
+	// sem bounds MaxInFlightRequests: a slot is acquired before a request
+	// is written and released once its response has been received (or it
+	// failed outright), so at most MaxInFlightRequests requests are
+	// unacknowledged at any time.
+	sem chan struct{}
+
+	metrics *ConnMetrics
 }
 
-func newTLSConnection(address string, ca, cert, key []byte, timeout, readTimeout time.Duration) (*connection, error) {
+func newTLSConnection(address string, ca, cert, key []byte, timeout, readTimeout time.Duration, sasl *SASLConfig, maxInFlight int) (*connection, error) {
 	roots := x509.NewCertPool()
 	ok := roots.AppendCertsFromPEM(ca)
 	if !ok {
@@ -57,22 +80,18 @@ func newTLSConnection(address string, ca, cert, key []byte, timeout, readTimeout
 	if err != nil {
 		return nil, err
 	}
-	c := &connection{
-		stop:        make(chan struct{}),
-		nextID:      make(chan int32),
-		rw:          conn,
-		respc:       make(map[int32]chan []byte),
-		logger:      &nullLogger{},
-		readTimeout: readTimeout,
-		apiVersions: make(map[int16]proto.SupportedVersion),
+	c := newConnectionFrom(conn, readTimeout, maxInFlight)
+	if sasl != nil {
+		if err := authenticateSASL(c, *sasl); err != nil {
+			c.Close()
+			return nil, err
+		}
 	}
-	go c.nextIDLoop()
-	go c.readRespLoop()
 	return c, nil
 }
 
 // newConnection returns new, initialized connection or error
-func newTCPConnection(address string, timeout, readTimeout time.Duration) (*connection, error) {
+func newTCPConnection(address string, timeout, readTimeout time.Duration, sasl *SASLConfig, maxInFlight int) (*connection, error) {
 	dialer := net.Dialer{
 		Timeout:   timeout,
 		KeepAlive: 30 * time.Second,
@@ -81,6 +100,23 @@ func newTCPConnection(address string, timeout, readTimeout time.Duration) (*conn
 	if err != nil {
 		return nil, err
 	}
+	c := newConnectionFrom(conn, readTimeout, maxInFlight)
+	if sasl != nil {
+		if err := authenticateSASL(c, *sasl); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// newConnectionFrom wraps an already-dialed net.Conn, starting the
+// goroutines that generate correlation IDs, pipeline writes and demultiplex
+// responses.
+func newConnectionFrom(conn net.Conn, readTimeout time.Duration, maxInFlight int) *connection {
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlightRequests
+	}
 	c := &connection{
 		stop:        make(chan struct{}),
 		nextID:      make(chan int32),
@@ -89,10 +125,15 @@ func newTCPConnection(address string, timeout, readTimeout time.Duration) (*conn
 		logger:      &nullLogger{},
 		readTimeout: readTimeout,
 		apiVersions: make(map[int16]proto.SupportedVersion),
+		tracer:      noopTracer{},
+		writec:      make(chan *writePromise),
+		sem:         make(chan struct{}, maxInFlight),
+		metrics:     newConnMetrics(),
 	}
 	go c.nextIDLoop()
+	go c.writeLoop()
 	go c.readRespLoop()
-	return c, nil
+	return c
 }
 
 //getBestVersion returns version for passed apiKey which best fit server and client requirements
@@ -138,6 +179,86 @@ func (c *connection) nextIDLoop() {
 	}
 }
 
+// writePromise is one entry of the pipelined write queue: payload is the
+// already-encoded request frame and errc receives the outcome of writing it
+// (nil on success). Writing a frame never implies its response has
+// arrived - waiting for that still goes through respWaiter/waitResp.
+type writePromise struct {
+	payload []byte
+	errc    chan error
+}
+
+// writeLoop is the single writer goroutine for this connection. Every
+// request method funnels its encoded frame through writec instead of
+// calling rw.Write directly, so frames always land on the wire whole and
+// back-to-back, regardless of how many goroutines are producing them
+// concurrently.
+func (c *connection) writeLoop() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case wp := <-c.writec:
+			c.metrics.queueDepth.Add(-1)
+			_, err := c.rw.Write(wp.payload)
+			wp.errc <- err
+		}
+	}
+}
+
+// acquireSlot blocks until an in-flight slot is available or ctx is done,
+// bounding the number of unacknowledged requests to MaxInFlightRequests.
+func (c *connection) acquireSlot(ctx context.Context) error {
+	select {
+	case c.sem <- struct{}{}:
+		c.metrics.inFlight.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.stop:
+		return c.stopErr
+	}
+}
+
+func (c *connection) releaseSlot() {
+	c.metrics.inFlight.Add(-1)
+	<-c.sem
+}
+
+// enqueueWrite encodes req and hands it to writeLoop, blocking until the
+// frame has actually been written to the socket (or failed to write, or ctx
+// expired first).
+func (c *connection) enqueueWrite(ctx context.Context, req frameWriter) error {
+	var buf bytes.Buffer
+	if _, err := req.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	wp := &writePromise{payload: buf.Bytes(), errc: make(chan error, 1)}
+	c.metrics.queueDepth.Add(1)
+	select {
+	case c.writec <- wp:
+	case <-ctx.Done():
+		c.metrics.queueDepth.Add(-1)
+		return ctx.Err()
+	case <-c.stop:
+		c.metrics.queueDepth.Add(-1)
+		return c.stopErr
+	}
+
+	select {
+	case err := <-wp.errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// frameWriter is satisfied by every proto.*Req type.
+type frameWriter interface {
+	WriteTo(w io.Writer) (int64, error)
+}
+
 // readRespLoop constantly reading response messages from the socket and after
 // partial parsing, sends byte representation of the whole message to request
 // sending process.
@@ -241,59 +362,138 @@ func (c *connection) Close() error {
 	return c.rw.Close()
 }
 
-// APIVersions sends a request to fetch the supported versions for each API.
-// Versioning is only supported in Kafka versions above 0.10.0.0
-func (c *connection) APIVersions(req *proto.APIVersionsReq) (*proto.APIVersionsResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
+// nextCorrelationID blocks until a correlation ID is available, honoring ctx
+// cancellation so callers are never stuck behind a connection that stopped
+// generating IDs.
+func (c *connection) nextCorrelationID(ctx context.Context) (int32, error) {
+	select {
+	case id, ok := <-c.nextID:
+		if !ok {
+			return 0, c.stopErr
+		}
+		return id, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// waitResp blocks on respc until a response arrives or ctx is done. When ctx
+// fires first, the waiter registered under correlationID is released so the
+// read loop does not leak it, and ctx.Err() is returned wrapped with enough
+// context to tell it apart from a plain connection close.
+func (c *connection) waitResp(ctx context.Context, correlationID int32, respc chan []byte) ([]byte, error) {
+	select {
+	case b, ok := <-respc:
+		if !ok {
+			return nil, c.stopErr
+		}
+		return b, nil
+	case <-ctx.Done():
+		c.releaseWaiter(correlationID)
+		// readRespLoop may already have taken respc out of the waiters map
+		// and be about to send on it; drain it until it is closed so that
+		// send never blocks the read loop.
+		go func() {
+			for range respc {
+			}
+		}()
+		return nil, fmt.Errorf("waiting for response: %w", ctx.Err())
 	}
+}
 
-	respc, err := c.respWaiter(req.CorrelationID)
+// roundTrip bounds, pipelines and traces a single request/response
+// exchange: it waits for a free in-flight slot, writes req through the
+// shared writer goroutine, waits for the matching response, and releases
+// the slot as soon as the exchange is resolved one way or another. Callers
+// set req.CorrelationID (and Version, where applicable) before calling this.
+//
+// roundTrip itself only knows the transport-level outcome, not the
+// Kafka-level error code carried inside a successfully received response -
+// that requires decoding, which happens in the caller after roundTrip
+// returns. So roundTrip finishes the returned span itself only when err is
+// non-nil (the transport/ctx failure is all there ever will be to report);
+// on success it leaves the span open and returns it so the caller can tag
+// the decoded response error code before calling span.Finish(err) once
+// decoding is done.
+func (c *connection) roundTrip(ctx context.Context, spanName string, apiKey, apiVersion int16, correlationID int32, req frameWriter, tags map[string]interface{}) (b []byte, span Span, err error) {
+	if err = c.acquireSlot(ctx); err != nil {
+		return nil, noopSpan{}, err
+	}
+	defer c.releaseSlot()
+
+	span = c.startSpan(ctx, spanName, apiKey, apiVersion, correlationID, tags)
+	start := time.Now()
+	defer func() { c.metrics.observe(apiKey, time.Since(start)) }()
+
+	respc, err := c.respWaiter(correlationID)
 	if err != nil {
 		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		err = fmt.Errorf("wait for response: %s", err)
+		span.Finish(err)
+		return nil, span, err
 	}
-
-	if _, err := req.WriteTo(c.rw); err != nil {
+	if err = c.enqueueWrite(ctx, req); err != nil {
 		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+		c.releaseWaiter(correlationID)
+		span.Finish(err)
+		return nil, span, err
+	}
+	b, err = c.waitResp(ctx, correlationID, respc)
+	if err != nil {
+		span.Finish(err)
+	}
+	return b, span, err
+}
+
+// APIVersions sends a request to fetch the supported versions for each API.
+// Versioning is only supported in Kafka versions above 0.10.0.0
+func (c *connection) APIVersions(req *proto.APIVersionsReq) (*proto.APIVersionsResp, error) {
+	return c.APIVersionsCtx(context.Background(), req)
+}
+
+// APIVersionsCtx behaves like APIVersions, but the request can be cancelled
+// or bound by a deadline through ctx.
+func (c *connection) APIVersionsCtx(ctx context.Context, req *proto.APIVersionsReq) (*proto.APIVersionsResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
+	req.CorrelationID = id
+
+	b, span, err := c.roundTrip(ctx, "kafka.api_versions", proto.APIVersionsReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
+		return nil, err
 	}
-	return proto.ReadAPIVersionsResp(bytes.NewReader(b))
+	resp, err := proto.ReadAPIVersionsResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
 }
 
 // Metadata sends given metadata request to kafka node and returns related
 // metadata response.
 // Calling this method on closed connection will always return ErrClosed.
 func (c *connection) Metadata(req *proto.MetadataReq) (*proto.MetadataResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
-	}
+	return c.MetadataCtx(context.Background(), req)
+}
 
-	respc, err := c.respWaiter(req.CorrelationID)
+// MetadataCtx behaves like Metadata, but the request can be cancelled or
+// bound by a deadline through ctx, independently of the connection's
+// readTimeout.
+func (c *connection) MetadataCtx(ctx context.Context, req *proto.MetadataReq) (*proto.MetadataResp, error) {
+	id, err := c.nextCorrelationID(ctx)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
-
+	req.CorrelationID = id
 	req.Version = c.getBestVersion(proto.MetadataReqKind)
 
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+	b, span, err := c.roundTrip(ctx, "kafka.metadata", proto.MetadataReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
-	}
-	return proto.ReadMetadataResp(bytes.NewReader(b), req.Version)
+	resp, err := proto.ReadMetadataResp(bytes.NewReader(b), req.Version)
+	span.Finish(err)
+	return resp, err
 }
 
 // Produce sends given produce request to kafka node and returns related
@@ -301,58 +501,95 @@ func (c *connection) Metadata(req *proto.MetadataReq) (*proto.MetadataResp, erro
 // right after sending request, without waiting for response.
 // Calling this method on closed connection will always return ErrClosed.
 func (c *connection) Produce(req *proto.ProduceReq) (*proto.ProduceResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
+	return c.ProduceCtx(context.Background(), req)
+}
+
+// ProduceCtx behaves like Produce, but the wait for the response honors ctx
+// cancellation and deadlines. Fire-and-forget requests (RequiredAcks ==
+// proto.RequiredAcksNone) never wait for a response or take an in-flight
+// slot; for them ctx only bounds getting a correlation ID and writing the
+// request.
+func (c *connection) ProduceCtx(ctx context.Context, req *proto.ProduceReq) (*proto.ProduceResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
+		return nil, err
 	}
+	req.CorrelationID = id
+	req.Version = c.getBestVersion(proto.ProduceReqKind)
+
+	c.mu.Lock()
+	tracer := c.tracer
+	c.mu.Unlock()
+	injectProduceTrace(ctx, tracer, req)
 
 	if req.RequiredAcks == proto.RequiredAcksNone {
-		_, err := req.WriteTo(c.rw)
-		return nil, err
+		return nil, c.enqueueWrite(ctx, req)
 	}
 
-	respc, err := c.respWaiter(req.CorrelationID)
+	b, span, err := c.roundTrip(ctx, "kafka.produce", proto.ProduceReqKind, req.Version, req.CorrelationID, req, produceSpanTags(req))
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
+	resp, err := proto.ReadProduceResp(bytes.NewReader(b))
+	if resp != nil {
+		span.SetTag("kafka.error_code", produceErrorCode(resp))
+	}
+	span.Finish(err)
+	return resp, err
+}
 
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
-		return nil, err
+// produceSpanTags summarizes req's topics/partitions for startSpan, cheaply
+// computed from fields already set before the request goes on the wire.
+func produceSpanTags(req *proto.ProduceReq) map[string]interface{} {
+	topics := make([]string, 0, len(req.Topics))
+	partitions := 0
+	for _, t := range req.Topics {
+		topics = append(topics, t.Name)
+		partitions += len(t.Partitions)
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
+	return map[string]interface{}{
+		"kafka.topics":          topics,
+		"kafka.partition_count": partitions,
 	}
-	return proto.ReadProduceResp(bytes.NewReader(b))
+}
+
+// produceErrorCode returns the first non-zero per-partition error code in
+// resp, or 0 if every partition succeeded. It is a best-effort summary for
+// tracing - callers that need the full per-partition picture already get it
+// from resp.Topics directly.
+func produceErrorCode(resp *proto.ProduceResp) int16 {
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			if p.ErrorCode != 0 {
+				return p.ErrorCode
+			}
+		}
+	}
+	return 0
 }
 
 // Fetch sends given fetch request to kafka node and returns related response.
 // Calling this method on closed connection will always return ErrClosed.
 func (c *connection) Fetch(req *proto.FetchReq) (*proto.FetchResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
-	}
+	return c.FetchCtx(context.Background(), req)
+}
 
-	respc, err := c.respWaiter(req.CorrelationID)
+// FetchCtx behaves like Fetch, but the request can be cancelled or bound by
+// a deadline through ctx - handy for bounding a single long poll without
+// tearing down the whole connection.
+func (c *connection) FetchCtx(ctx context.Context, req *proto.FetchReq) (*proto.FetchResp, error) {
+	id, err := c.nextCorrelationID(ctx)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
+	req.CorrelationID = id
 
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+	b, span, err := c.roundTrip(ctx, "kafka.fetch", proto.FetchReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
-	}
 	resp, err := proto.ReadFetchResp(bytes.NewReader(b))
+	span.Finish(err)
 	if err != nil {
 		return nil, err
 	}
@@ -383,94 +620,221 @@ func (c *connection) Fetch(req *proto.FetchReq) (*proto.FetchResp, error) {
 // Offset sends given offset request to kafka node and returns related response.
 // Calling this method on closed connection will always return ErrClosed.
 func (c *connection) Offset(req *proto.OffsetReq) (*proto.OffsetResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
-	}
+	return c.OffsetCtx(context.Background(), req)
+}
 
-	respc, err := c.respWaiter(req.CorrelationID)
+// OffsetCtx behaves like Offset, but the request can be cancelled or bound
+// by a deadline through ctx.
+func (c *connection) OffsetCtx(ctx context.Context, req *proto.OffsetReq) (*proto.OffsetResp, error) {
+	id, err := c.nextCorrelationID(ctx)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
+	req.CorrelationID = id
 
 	// TODO(husio) documentation is not mentioning this directly, but I assume
 	// -1 is for non node clients
 	req.ReplicaID = -1
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+
+	b, span, err := c.roundTrip(ctx, "kafka.offset", proto.OffsetReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
-	}
-	return proto.ReadOffsetResp(bytes.NewReader(b))
+	resp, err := proto.ReadOffsetResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
 }
 
 func (c *connection) ConsumerMetadata(req *proto.ConsumerMetadataReq) (*proto.ConsumerMetadataResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
+	return c.ConsumerMetadataCtx(context.Background(), req)
+}
+
+// ConsumerMetadataCtx behaves like ConsumerMetadata, but the request can be
+// cancelled or bound by a deadline through ctx.
+func (c *connection) ConsumerMetadataCtx(ctx context.Context, req *proto.ConsumerMetadataReq) (*proto.ConsumerMetadataResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
+		return nil, err
 	}
-	respc, err := c.respWaiter(req.CorrelationID)
+	req.CorrelationID = id
+
+	b, span, err := c.roundTrip(ctx, "kafka.consumer_metadata", proto.ConsumerMetadataReqKind, req.Version, req.CorrelationID, req, nil)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+	resp, err := proto.ReadConsumerMetadataResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
+}
+
+func (c *connection) OffsetCommit(req *proto.OffsetCommitReq) (*proto.OffsetCommitResp, error) {
+	return c.OffsetCommitCtx(context.Background(), req)
+}
+
+// OffsetCommitCtx behaves like OffsetCommit, but the request can be
+// cancelled or bound by a deadline through ctx.
+func (c *connection) OffsetCommitCtx(ctx context.Context, req *proto.OffsetCommitReq) (*proto.OffsetCommitResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
+	req.CorrelationID = id
+
+	b, span, err := c.roundTrip(ctx, "kafka.offset_commit", proto.OffsetCommitReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
+		return nil, err
 	}
-	return proto.ReadConsumerMetadataResp(bytes.NewReader(b))
+	resp, err := proto.ReadOffsetCommitResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
 }
 
-func (c *connection) OffsetCommit(req *proto.OffsetCommitReq) (*proto.OffsetCommitResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
+func (c *connection) OffsetFetch(req *proto.OffsetFetchReq) (*proto.OffsetFetchResp, error) {
+	return c.OffsetFetchCtx(context.Background(), req)
+}
+
+// OffsetFetchCtx behaves like OffsetFetch, but the request can be cancelled
+// or bound by a deadline through ctx.
+func (c *connection) OffsetFetchCtx(ctx context.Context, req *proto.OffsetFetchReq) (*proto.OffsetFetchResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
+		return nil, err
 	}
-	respc, err := c.respWaiter(req.CorrelationID)
+	req.CorrelationID = id
+
+	b, span, err := c.roundTrip(ctx, "kafka.offset_fetch", proto.OffsetFetchReqKind, req.Version, req.CorrelationID, req, nil)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+	resp, err := proto.ReadOffsetFetchResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
+}
+
+// SaslHandshake advertises the SASL mechanism the client intends to use and
+// must be the first request sent on a freshly dialed connection that
+// requires authentication, before any other request method is called.
+func (c *connection) SaslHandshake(req *proto.SaslHandshakeReq) (*proto.SaslHandshakeResp, error) {
+	return c.SaslHandshakeCtx(context.Background(), req)
+}
+
+// SaslHandshakeCtx behaves like SaslHandshake, but the request can be
+// cancelled or bound by a deadline through ctx.
+func (c *connection) SaslHandshakeCtx(ctx context.Context, req *proto.SaslHandshakeReq) (*proto.SaslHandshakeResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
+	req.CorrelationID = id
+
+	b, span, err := c.roundTrip(ctx, "kafka.sasl_handshake", proto.SaslHandshakeReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
+		return nil, err
 	}
-	return proto.ReadOffsetCommitResp(bytes.NewReader(b))
+	resp, err := proto.ReadSaslHandshakeResp(bytes.NewReader(b))
+	if resp != nil {
+		span.SetTag("kafka.error_code", resp.ErrorCode)
+	}
+	span.Finish(err)
+	return resp, err
 }
 
-func (c *connection) OffsetFetch(req *proto.OffsetFetchReq) (*proto.OffsetFetchResp, error) {
-	var ok bool
-	if req.CorrelationID, ok = <-c.nextID; !ok {
-		return nil, c.stopErr
+// SaslAuthenticate exchanges one round of SASL authentication bytes with the
+// broker. Depending on the mechanism, it may need to be called more than
+// once (e.g. SCRAM's client-first/server-first/client-final/server-final
+// exchange).
+func (c *connection) SaslAuthenticate(req *proto.SaslAuthenticateReq) (*proto.SaslAuthenticateResp, error) {
+	return c.SaslAuthenticateCtx(context.Background(), req)
+}
+
+// SaslAuthenticateCtx behaves like SaslAuthenticate, but the request can be
+// cancelled or bound by a deadline through ctx.
+func (c *connection) SaslAuthenticateCtx(ctx context.Context, req *proto.SaslAuthenticateReq) (*proto.SaslAuthenticateResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
+		return nil, err
 	}
-	respc, err := c.respWaiter(req.CorrelationID)
+	req.CorrelationID = id
+	req.Version = c.getBestVersion(proto.SaslAuthenticateReqKind)
+
+	b, span, err := c.roundTrip(ctx, "kafka.sasl_authenticate", proto.SaslAuthenticateReqKind, req.Version, req.CorrelationID, req, nil)
 	if err != nil {
-		c.logger.Error("msg", "failed waiting for response", "error", err)
-		return nil, fmt.Errorf("wait for response: %s", err)
+		return nil, err
 	}
-	if _, err := req.WriteTo(c.rw); err != nil {
-		c.logger.Error("msg", "cannot write", "error", err)
-		c.releaseWaiter(req.CorrelationID)
+	resp, err := proto.ReadSaslAuthenticateResp(bytes.NewReader(b), req.Version)
+	if resp != nil {
+		span.SetTag("kafka.error_code", resp.ErrorCode)
+	}
+	span.Finish(err)
+	return resp, err
+}
+
+// AlterPartitionReassignments submits a KIP-455 reassignment: per
+// topic-partition, a new replica list, or nil to cancel a reassignment
+// already in progress. It must be sent to the controller broker - callers
+// are expected to have resolved the controller ID from a prior Metadata
+// call and dialed a connection to it.
+func (c *connection) AlterPartitionReassignments(req *proto.AlterPartitionReassignmentsReq) (*proto.AlterPartitionReassignmentsResp, error) {
+	return c.AlterPartitionReassignmentsCtx(context.Background(), req)
+}
+
+// AlterPartitionReassignmentsCtx behaves like AlterPartitionReassignments,
+// but the request can be cancelled or bound by a deadline through ctx.
+func (c *connection) AlterPartitionReassignmentsCtx(ctx context.Context, req *proto.AlterPartitionReassignmentsReq) (*proto.AlterPartitionReassignmentsResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
 		return nil, err
 	}
-	b, ok := <-respc
-	if !ok {
-		return nil, c.stopErr
+	req.CorrelationID = id
+	req.Version = c.getBestVersion(proto.AlterPartitionReassignmentsReqKind)
+
+	b, span, err := c.roundTrip(ctx, "kafka.alter_partition_reassignments", proto.AlterPartitionReassignmentsReqKind, req.Version, req.CorrelationID, req, alterReassignmentSpanTags(req))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := proto.ReadAlterPartitionReassignmentsResp(bytes.NewReader(b), req.Version)
+	if resp != nil {
+		span.SetTag("kafka.error_code", resp.ErrorCode)
+	}
+	span.Finish(err)
+	return resp, err
+}
+
+// alterReassignmentSpanTags summarizes req's topics for startSpan, cheaply
+// computed from fields already set before the request goes on the wire.
+func alterReassignmentSpanTags(req *proto.AlterPartitionReassignmentsReq) map[string]interface{} {
+	topics := make([]string, 0, len(req.Topics))
+	for _, t := range req.Topics {
+		topics = append(topics, t.Topic)
+	}
+	return map[string]interface{}{"kafka.topics": topics}
+}
+
+// ListPartitionReassignments returns the reassignments currently in
+// progress, optionally filtered to the topics named in req. Like
+// AlterPartitionReassignments, it must be sent to the controller broker.
+func (c *connection) ListPartitionReassignments(req *proto.ListPartitionReassignmentsReq) (*proto.ListPartitionReassignmentsResp, error) {
+	return c.ListPartitionReassignmentsCtx(context.Background(), req)
+}
+
+// ListPartitionReassignmentsCtx behaves like ListPartitionReassignments, but
+// the request can be cancelled or bound by a deadline through ctx.
+func (c *connection) ListPartitionReassignmentsCtx(ctx context.Context, req *proto.ListPartitionReassignmentsReq) (*proto.ListPartitionReassignmentsResp, error) {
+	id, err := c.nextCorrelationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.CorrelationID = id
+	req.Version = c.getBestVersion(proto.ListPartitionReassignmentsReqKind)
+
+	b, span, err := c.roundTrip(ctx, "kafka.list_partition_reassignments", proto.ListPartitionReassignmentsReqKind, req.Version, req.CorrelationID, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := proto.ReadListPartitionReassignmentsResp(bytes.NewReader(b), req.Version)
+	if resp != nil {
+		span.SetTag("kafka.error_code", resp.ErrorCode)
 	}
-	return proto.ReadOffsetFetchResp(bytes.NewReader(b))
+	span.Finish(err)
+	return resp, err
 }
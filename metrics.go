@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyWindowSize bounds how many recent samples are kept per API key -
+// enough to eyeball p50/p99 behavior without the window growing unbounded
+// on a long-lived connection.
+const latencyWindowSize = 256
+
+// ConnMetrics exposes the pipelined-dispatch counters of a single
+// connection: how many writes are queued ahead of the writer goroutine, how
+// many requests are currently in flight, and recent per-API latencies. It
+// is safe for concurrent use.
+type ConnMetrics struct {
+	queueDepth atomic.Int64
+	inFlight   atomic.Int64
+
+	mu        sync.Mutex
+	latencies map[int16]*latencyWindow
+}
+
+func newConnMetrics() *ConnMetrics {
+	return &ConnMetrics{
+		latencies: make(map[int16]*latencyWindow),
+	}
+}
+
+// QueueDepth returns the number of writes currently waiting for the writer
+// goroutine to pick them up.
+func (m *ConnMetrics) QueueDepth() int64 {
+	return m.queueDepth.Load()
+}
+
+// InFlight returns the number of requests holding an in-flight slot: the
+// slot is taken just before the request is written and given back once its
+// response has arrived or the request has failed.
+func (m *ConnMetrics) InFlight() int64 {
+	return m.inFlight.Load()
+}
+
+// Latencies returns a copy of the recent round-trip latencies recorded for
+// apiKey, oldest first. It returns nil if no request for apiKey has
+// completed yet.
+func (m *ConnMetrics) Latencies(apiKey int16) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.latencies[apiKey]
+	if !ok {
+		return nil
+	}
+	return w.snapshot()
+}
+
+func (m *ConnMetrics) observe(apiKey int16, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.latencies[apiKey]
+	if !ok {
+		w = newLatencyWindow(latencyWindowSize)
+		m.latencies[apiKey] = w
+	}
+	w.add(d)
+}
+
+// latencyWindow is a fixed-size ring buffer of the most recent latency
+// samples for one API key.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	filled  bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.samples[w.next] = d
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.filled = true
+	}
+}
+
+func (w *latencyWindow) snapshot() []time.Duration {
+	if !w.filled {
+		out := make([]time.Duration, w.next)
+		copy(out, w.samples[:w.next])
+		return out
+	}
+	out := make([]time.Duration, len(w.samples))
+	copy(out, w.samples[w.next:])
+	copy(out[len(w.samples)-w.next:], w.samples[:w.next])
+	return out
+}
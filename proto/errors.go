@@ -0,0 +1,36 @@
+package proto
+
+import "strconv"
+
+// KafkaError is a broker-reported error code, as returned inline in most
+// response structures. Its Error method renders the code's well-known name
+// when known, falling back to the bare numeric value otherwise so an
+// unrecognized code (e.g. one added by a newer broker) never panics or
+// prints nothing useful.
+type KafkaError int16
+
+// kafkaErrorNames is not exhaustive - it only covers the codes this client
+// currently has a reason to name explicitly.
+var kafkaErrorNames = map[int16]string{
+	0:  "NoError",
+	5:  "LeaderNotAvailable",
+	6:  "NotLeaderForPartition",
+	33: "UnsupportedSaslMechanism",
+	34: "IllegalSaslState",
+	85: "NoReassignmentInProgress",
+}
+
+// Sentinel KafkaError values for the partition-level produce errors this
+// client checks for explicitly, e.g. to decide whether a failed partition is
+// worth retrying.
+const (
+	ErrLeaderNotAvailable    KafkaError = 5
+	ErrNotLeaderForPartition KafkaError = 6
+)
+
+func (e KafkaError) Error() string {
+	if name, ok := kafkaErrorNames[int16(e)]; ok {
+		return name
+	}
+	return "KafkaError(" + strconv.Itoa(int(e)) + ")"
+}
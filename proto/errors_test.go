@@ -0,0 +1,23 @@
+package proto
+
+import "testing"
+
+func TestKafkaErrorNames(t *testing.T) {
+	cases := []struct {
+		code KafkaError
+		want string
+	}{
+		{0, "NoError"},
+		{ErrLeaderNotAvailable, "LeaderNotAvailable"},
+		{ErrNotLeaderForPartition, "NotLeaderForPartition"},
+		{33, "UnsupportedSaslMechanism"},
+		{34, "IllegalSaslState"},
+		{85, "NoReassignmentInProgress"},
+		{12345, "KafkaError(12345)"},
+	}
+	for _, c := range cases {
+		if got := c.code.Error(); got != c.want {
+			t.Errorf("KafkaError(%d).Error() = %q, want %q", c.code, got, c.want)
+		}
+	}
+}
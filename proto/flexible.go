@@ -0,0 +1,218 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FlexibleVersions maps an API key to the lowest request/response version
+// on which it switches to KIP-482 "flexible" encoding (compact
+// strings/arrays and a trailing tagged-fields section). An API key absent
+// from this map never uses flexible encoding.
+var FlexibleVersions = map[int16]int16{
+	SaslAuthenticateReqKind:            2,
+	AlterPartitionReassignmentsReqKind: 0,
+	ListPartitionReassignmentsReqKind:  0,
+}
+
+// IsFlexible reports whether the given negotiated version of apiKey uses
+// KIP-482 flexible encoding.
+func IsFlexible(apiKey, version int16) bool {
+	min, ok := FlexibleVersions[apiKey]
+	return ok && version >= min
+}
+
+// writeUvarint appends v to buf using the Kafka/protobuf base-128 varint
+// encoding (least significant group first, high bit set on all but the
+// last byte).
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// writeVarint zigzag-encodes v so small negative numbers stay small, then
+// writes it the same way as writeUvarint.
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// readUvarint reads a base-128 varint from r.
+func readUvarint(r io.ByteReader) (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+// readVarint reads a zigzag base-128 varint from r.
+func readVarint(r io.ByteReader) (int64, error) {
+	return binary.ReadVarint(r)
+}
+
+// writeCompactString writes s as a KIP-482 compact string: an unsigned
+// varint holding len(s)+1, followed by the raw bytes. An empty string is
+// encoded as length 1 (i.e. N=1, zero bytes follow); a genuinely null
+// compact string (N=0) is never produced here - use
+// writeCompactNullableString for fields that support it.
+func writeCompactString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s))+1)
+	buf.WriteString(s)
+}
+
+// writeCompactNullableString is like writeCompactString but encodes a nil
+// string as N=0 with no following bytes, as used by fields documented as
+// nullable in the flexible protocol.
+func writeCompactNullableString(buf *bytes.Buffer, s *string) {
+	if s == nil {
+		writeUvarint(buf, 0)
+		return
+	}
+	writeCompactString(buf, *s)
+}
+
+// readCompactString reads a KIP-482 compact string. A length of 0 is
+// treated as an empty string for fields where null was never valid; callers
+// that need to distinguish null use readCompactNullableString instead.
+func readCompactString(r *bufio.Reader) (string, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return "", fmt.Errorf("read compact string length: %s", err)
+	}
+	if n == 0 {
+		return "", nil
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("read compact string: %s", err)
+	}
+	return string(b), nil
+}
+
+// readCompactNullableString is like readCompactString but returns a nil
+// *string for a length of 0 (the wire representation of null).
+func readCompactNullableString(r *bufio.Reader) (*string, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read compact string length: %s", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("read compact string: %s", err)
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// writeCompactArrayLen writes the length prefix (n+1, or 0 for a null
+// array) shared by every KIP-482 compact array. Callers write the n
+// elements themselves immediately afterwards.
+func writeCompactArrayLen(buf *bytes.Buffer, n int) {
+	if n < 0 {
+		writeUvarint(buf, 0)
+		return
+	}
+	writeUvarint(buf, uint64(n)+1)
+}
+
+// readCompactArrayLen reads a compact array length prefix and returns the
+// element count, or -1 for a null array.
+func readCompactArrayLen(r *bufio.Reader) (int, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return 0, fmt.Errorf("read compact array length: %s", err)
+	}
+	if n == 0 {
+		return -1, nil
+	}
+	return int(n - 1), nil
+}
+
+// writeCompactBytes writes b as a KIP-482 compact byte array: an unsigned
+// varint holding len(b)+1, followed by the raw bytes. A nil slice is encoded
+// as N=0 (null), matching writeCompactNullableString's nil handling.
+func writeCompactBytes(buf *bytes.Buffer, b []byte) {
+	if b == nil {
+		writeUvarint(buf, 0)
+		return
+	}
+	writeUvarint(buf, uint64(len(b))+1)
+	buf.Write(b)
+}
+
+// readCompactBytes reads a KIP-482 compact byte array, returning nil for the
+// null (N=0) case.
+func readCompactBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read compact bytes length: %s", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("read compact bytes: %s", err)
+	}
+	return b, nil
+}
+
+// TaggedField is one entry of a KIP-482 tagged-fields section: an
+// application-defined tag number and its raw, type-specific payload.
+type TaggedField struct {
+	Tag  uint64
+	Data []byte
+}
+
+// TaggedFields is the trailing tagged-fields section present on every
+// flexible request/response (and, per-field, on some structures within
+// them). readTaggedFields returns every tag it reads, recognized or not, as
+// raw entries; the response decoders in this package skip the sections
+// without keeping them on the decoded response.
+type TaggedFields []TaggedField
+
+// WriteTo appends the tagged-fields section to buf: an unsigned varint
+// count followed by <tag, length, data> for each field.
+func (tf TaggedFields) WriteTo(buf *bytes.Buffer) {
+	writeUvarint(buf, uint64(len(tf)))
+	for _, f := range tf {
+		writeUvarint(buf, f.Tag)
+		writeUvarint(buf, uint64(len(f.Data)))
+		buf.Write(f.Data)
+	}
+}
+
+// readTaggedFields reads a tagged-fields section. Fields with unknown tags
+// are kept as opaque TaggedField entries instead of causing an error, so
+// that future broker versions remain forward-compatible with this client.
+func readTaggedFields(r *bufio.Reader) (TaggedFields, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read tagged field count: %s", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	fields := make(TaggedFields, 0, n)
+	for i := uint64(0); i < n; i++ {
+		tag, err := readUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read tagged field tag: %s", err)
+		}
+		size, err := readUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("read tagged field length: %s", err)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("read tagged field data: %s", err)
+		}
+		fields = append(fields, TaggedField{Tag: tag, Data: data})
+	}
+	return fields, nil
+}
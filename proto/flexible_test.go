@@ -0,0 +1,70 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestCompactArrayLenRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		n    int
+	}{
+		{"null", -1},
+		{"empty", 0},
+		{"three elements", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeCompactArrayLen(&buf, c.n)
+
+			got, err := readCompactArrayLen(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("readCompactArrayLen: %s", err)
+			}
+			if got != c.n {
+				t.Fatalf("got %d, want %d", got, c.n)
+			}
+		})
+	}
+}
+
+func TestCompactArrayLenNilVsEmptyAreDistinct(t *testing.T) {
+	var nilBuf, emptyBuf bytes.Buffer
+	writeCompactArrayLen(&nilBuf, -1)
+	writeCompactArrayLen(&emptyBuf, 0)
+
+	if bytes.Equal(nilBuf.Bytes(), emptyBuf.Bytes()) {
+		t.Fatalf("null and empty array encodings must differ, got %v for both", nilBuf.Bytes())
+	}
+}
+
+func TestCompactStringRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	writeCompactString(&buf, "hello")
+
+	got, err := readCompactString(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("readCompactString: %s", err)
+	}
+	if got != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestTaggedFieldsRoundTrip(t *testing.T) {
+	fields := TaggedFields{{Tag: 1, Data: []byte("abc")}}
+
+	var buf bytes.Buffer
+	fields.WriteTo(&buf)
+
+	got, err := readTaggedFields(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("readTaggedFields: %s", err)
+	}
+	if len(got) != 1 || got[0].Tag != 1 || string(got[0].Data) != "abc" {
+		t.Fatalf("got %+v, want %+v", got, fields)
+	}
+}
@@ -0,0 +1,335 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+const (
+	AlterPartitionReassignmentsReqKind = 45
+	ListPartitionReassignmentsReqKind  = 46
+)
+
+// AlterPartitionReassignmentsReqPartition carries the desired replica list
+// for a single partition. A nil Replicas cancels any reassignment already
+// in progress for that partition.
+type AlterPartitionReassignmentsReqPartition struct {
+	Partition int32
+	Replicas  []int32
+}
+
+// AlterPartitionReassignmentsReqTopic groups the per-partition entries of
+// AlterPartitionReassignmentsReq by topic name.
+type AlterPartitionReassignmentsReqTopic struct {
+	Topic      string
+	Partitions []AlterPartitionReassignmentsReqPartition
+}
+
+// AlterPartitionReassignmentsReq is the KIP-455 request used to start,
+// change or cancel an ongoing partition reassignment. Only valid on
+// versions >= FlexibleVersions[AlterPartitionReassignmentsReqKind]; must be
+// sent to the controller broker.
+type AlterPartitionReassignmentsReq struct {
+	CorrelationID int32
+	ClientID      string
+	Version       int16
+
+	TimeoutMs int32
+	Topics    []AlterPartitionReassignmentsReqTopic
+}
+
+func (r *AlterPartitionReassignmentsReq) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	writeRequestHeader(&buf, AlterPartitionReassignmentsReqKind, r.Version, r.CorrelationID, r.ClientID)
+	if IsFlexible(AlterPartitionReassignmentsReqKind, r.Version) {
+		// Flexible requests carry their own tagged-fields section right
+		// after the header, ahead of the body.
+		TaggedFields(nil).WriteTo(&buf)
+	}
+
+	var body bytes.Buffer
+	writeInt32(&body, r.TimeoutMs)
+	writeCompactArrayLen(&body, len(r.Topics))
+	for _, t := range r.Topics {
+		writeCompactString(&body, t.Topic)
+		writeCompactArrayLen(&body, len(t.Partitions))
+		for _, p := range t.Partitions {
+			writeInt32(&body, p.Partition)
+			if p.Replicas == nil {
+				// A nil Replicas cancels an in-progress reassignment and
+				// must go on the wire as a null array (-1), which is
+				// indistinguishable from an empty one once len() is taken.
+				writeCompactArrayLen(&body, -1)
+			} else {
+				writeCompactArrayLen(&body, len(p.Replicas))
+			}
+			for _, r := range p.Replicas {
+				writeInt32(&body, r)
+			}
+			TaggedFields(nil).WriteTo(&body)
+		}
+		TaggedFields(nil).WriteTo(&body)
+	}
+	TaggedFields(nil).WriteTo(&body)
+
+	buf.Write(body.Bytes())
+	return writeFramedMessage(w, buf.Bytes())
+}
+
+// AlterPartitionReassignmentsRespPartition is the per-partition result of
+// an AlterPartitionReassignmentsReq. ErrorCode is NoReassignmentInProgress
+// (among others) when Replicas in the request asked to cancel a
+// reassignment that was not running.
+type AlterPartitionReassignmentsRespPartition struct {
+	Partition    int32
+	ErrorCode    int16
+	ErrorMessage string
+}
+
+type AlterPartitionReassignmentsRespTopic struct {
+	Topic      string
+	Partitions []AlterPartitionReassignmentsRespPartition
+}
+
+type AlterPartitionReassignmentsResp struct {
+	ThrottleTimeMs int32
+	ErrorCode      int16
+	ErrorMessage   string
+	Topics         []AlterPartitionReassignmentsRespTopic
+}
+
+func ReadAlterPartitionReassignmentsResp(r io.Reader, version int16) (*AlterPartitionReassignmentsResp, error) {
+	br := bufio.NewReader(r)
+	resp := &AlterPartitionReassignmentsResp{}
+
+	if IsFlexible(AlterPartitionReassignmentsReqKind, version) {
+		// The flexible response header's own tagged-fields section sits
+		// ahead of the body and is not stripped by the generic response
+		// reader, which has no notion of per-API flexible versioning.
+		if _, err := readTaggedFields(br); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if resp.ThrottleTimeMs, err = readInt32(br); err != nil {
+		return nil, err
+	}
+	if resp.ErrorCode, err = readInt16(br); err != nil {
+		return nil, err
+	}
+	if msg, err := readCompactNullableString(br); err != nil {
+		return nil, err
+	} else if msg != nil {
+		resp.ErrorMessage = *msg
+	}
+
+	n, err := readCompactArrayLen(br)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	resp.Topics = make([]AlterPartitionReassignmentsRespTopic, n)
+	for ti := range resp.Topics {
+		t := &resp.Topics[ti]
+		if t.Topic, err = readCompactString(br); err != nil {
+			return nil, err
+		}
+		pn, err := readCompactArrayLen(br)
+		if err != nil {
+			return nil, err
+		}
+		if pn < 0 {
+			pn = 0
+		}
+		t.Partitions = make([]AlterPartitionReassignmentsRespPartition, pn)
+		for pi := range t.Partitions {
+			p := &t.Partitions[pi]
+			if p.Partition, err = readInt32(br); err != nil {
+				return nil, err
+			}
+			if p.ErrorCode, err = readInt16(br); err != nil {
+				return nil, err
+			}
+			msg, err := readCompactNullableString(br)
+			if err != nil {
+				return nil, err
+			}
+			if msg != nil {
+				p.ErrorMessage = *msg
+			}
+			if _, err := readTaggedFields(br); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := readTaggedFields(br); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := readTaggedFields(br); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ListPartitionReassignmentsReq returns the reassignments currently in
+// progress. A nil Topics requests every topic with a reassignment running.
+type ListPartitionReassignmentsReq struct {
+	CorrelationID int32
+	ClientID      string
+	Version       int16
+
+	TimeoutMs int32
+	Topics    []ListPartitionReassignmentsReqTopic
+}
+
+type ListPartitionReassignmentsReqTopic struct {
+	Topic      string
+	Partitions []int32
+}
+
+func (r *ListPartitionReassignmentsReq) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	writeRequestHeader(&buf, ListPartitionReassignmentsReqKind, r.Version, r.CorrelationID, r.ClientID)
+	if IsFlexible(ListPartitionReassignmentsReqKind, r.Version) {
+		TaggedFields(nil).WriteTo(&buf)
+	}
+
+	var body bytes.Buffer
+	writeInt32(&body, r.TimeoutMs)
+	if r.Topics == nil {
+		// A nil Topics requests every topic with a reassignment running
+		// and must go on the wire as a null array (-1), which is
+		// indistinguishable from an empty one once len() is taken.
+		writeCompactArrayLen(&body, -1)
+	} else {
+		writeCompactArrayLen(&body, len(r.Topics))
+	}
+	for _, t := range r.Topics {
+		writeCompactString(&body, t.Topic)
+		writeCompactArrayLen(&body, len(t.Partitions))
+		for _, p := range t.Partitions {
+			writeInt32(&body, p)
+		}
+		TaggedFields(nil).WriteTo(&body)
+	}
+	TaggedFields(nil).WriteTo(&body)
+
+	buf.Write(body.Bytes())
+	return writeFramedMessage(w, buf.Bytes())
+}
+
+// ListPartitionReassignmentsRespPartition describes one partition's current
+// replicas and any reassignment in progress for it.
+type ListPartitionReassignmentsRespPartition struct {
+	Partition       int32
+	Replicas        []int32
+	AddingReplicas  []int32
+	RemovingReplicas []int32
+}
+
+type ListPartitionReassignmentsRespTopic struct {
+	Topic      string
+	Partitions []ListPartitionReassignmentsRespPartition
+}
+
+type ListPartitionReassignmentsResp struct {
+	ThrottleTimeMs int32
+	ErrorCode      int16
+	ErrorMessage   string
+	Topics         []ListPartitionReassignmentsRespTopic
+}
+
+func ReadListPartitionReassignmentsResp(r io.Reader, version int16) (*ListPartitionReassignmentsResp, error) {
+	br := bufio.NewReader(r)
+	resp := &ListPartitionReassignmentsResp{}
+
+	if IsFlexible(ListPartitionReassignmentsReqKind, version) {
+		if _, err := readTaggedFields(br); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if resp.ThrottleTimeMs, err = readInt32(br); err != nil {
+		return nil, err
+	}
+	if resp.ErrorCode, err = readInt16(br); err != nil {
+		return nil, err
+	}
+	if msg, err := readCompactNullableString(br); err != nil {
+		return nil, err
+	} else if msg != nil {
+		resp.ErrorMessage = *msg
+	}
+
+	n, err := readCompactArrayLen(br)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	resp.Topics = make([]ListPartitionReassignmentsRespTopic, n)
+	for ti := range resp.Topics {
+		t := &resp.Topics[ti]
+		if t.Topic, err = readCompactString(br); err != nil {
+			return nil, err
+		}
+		pn, err := readCompactArrayLen(br)
+		if err != nil {
+			return nil, err
+		}
+		if pn < 0 {
+			pn = 0
+		}
+		t.Partitions = make([]ListPartitionReassignmentsRespPartition, pn)
+		for pi := range t.Partitions {
+			p := &t.Partitions[pi]
+			if p.Partition, err = readInt32(br); err != nil {
+				return nil, err
+			}
+			if p.Replicas, err = readCompactInt32Array(br); err != nil {
+				return nil, err
+			}
+			if p.AddingReplicas, err = readCompactInt32Array(br); err != nil {
+				return nil, err
+			}
+			if p.RemovingReplicas, err = readCompactInt32Array(br); err != nil {
+				return nil, err
+			}
+			if _, err := readTaggedFields(br); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := readTaggedFields(br); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := readTaggedFields(br); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readCompactInt32Array reads a KIP-482 compact array of int32, as used for
+// the replica lists in ListPartitionReassignmentsResp.
+func readCompactInt32Array(r *bufio.Reader) ([]int32, error) {
+	n, err := readCompactArrayLen(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	out := make([]int32, n)
+	for i := range out {
+		if out[i], err = readInt32(r); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,37 @@
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAlterPartitionReassignmentsReqNilReplicasCancelsReassignment guards
+// against nil and an empty (non-nil) Replicas slice collapsing to the same
+// wire encoding: nil must cancel an in-progress reassignment (a null
+// array), while an empty slice is a degenerate but distinct replica list.
+func TestAlterPartitionReassignmentsReqNilReplicasCancelsReassignment(t *testing.T) {
+	nilReq := &AlterPartitionReassignmentsReq{
+		ClientID: "test",
+		Topics: []AlterPartitionReassignmentsReqTopic{
+			{Topic: "t", Partitions: []AlterPartitionReassignmentsReqPartition{{Partition: 0, Replicas: nil}}},
+		},
+	}
+	emptyReq := &AlterPartitionReassignmentsReq{
+		ClientID: "test",
+		Topics: []AlterPartitionReassignmentsReqTopic{
+			{Topic: "t", Partitions: []AlterPartitionReassignmentsReqPartition{{Partition: 0, Replicas: []int32{}}}},
+		},
+	}
+
+	var nilBuf, emptyBuf bytes.Buffer
+	if _, err := nilReq.WriteTo(&nilBuf); err != nil {
+		t.Fatalf("WriteTo(nil Replicas): %s", err)
+	}
+	if _, err := emptyReq.WriteTo(&emptyBuf); err != nil {
+		t.Fatalf("WriteTo(empty Replicas): %s", err)
+	}
+
+	if bytes.Equal(nilBuf.Bytes(), emptyBuf.Bytes()) {
+		t.Fatalf("nil and empty Replicas must encode differently, got identical bytes %v", nilBuf.Bytes())
+	}
+}
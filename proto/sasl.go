@@ -0,0 +1,168 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	SaslHandshakeReqKind    = 17
+	SaslAuthenticateReqKind = 36
+)
+
+// SaslHandshakeReq advertises the SASL mechanism the client wants to use.
+// It must be the first request sent on a connection that requires
+// authentication.
+type SaslHandshakeReq struct {
+	CorrelationID int32
+	ClientID      string
+	Version       int16
+
+	Mechanism string
+}
+
+// WriteTo writes the request using the standard Kafka request header
+// followed by the mechanism as a string.
+func (r *SaslHandshakeReq) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	writeRequestHeader(&buf, SaslHandshakeReqKind, r.Version, r.CorrelationID, r.ClientID)
+	writeString(&buf, r.Mechanism)
+	return writeFramedMessage(w, buf.Bytes())
+}
+
+// SaslHandshakeResp lists the mechanisms enabled on the broker when
+// ErrorCode is UnsupportedSaslMechanism; otherwise EnabledMechanisms is
+// empty.
+type SaslHandshakeResp struct {
+	ErrorCode         int16
+	EnabledMechanisms []string
+}
+
+func ReadSaslHandshakeResp(r io.Reader) (*SaslHandshakeResp, error) {
+	dec := newRespDecoder(r)
+	resp := &SaslHandshakeResp{}
+	if err := binary.Read(dec, binary.BigEndian, &resp.ErrorCode); err != nil {
+		return nil, err
+	}
+	n, err := readArrayLen(dec)
+	if err != nil {
+		return nil, err
+	}
+	resp.EnabledMechanisms = make([]string, n)
+	for i := range resp.EnabledMechanisms {
+		s, err := readString(dec)
+		if err != nil {
+			return nil, err
+		}
+		resp.EnabledMechanisms[i] = s
+	}
+	return resp, nil
+}
+
+// SaslAuthenticateReq carries one round of mechanism-specific
+// authentication bytes - e.g. the PLAIN authzid/authcid/passwd triple or
+// one leg of the SCRAM exchange.
+type SaslAuthenticateReq struct {
+	CorrelationID int32
+	ClientID      string
+	Version       int16
+
+	AuthBytes []byte
+}
+
+func (r *SaslAuthenticateReq) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	writeRequestHeader(&buf, SaslAuthenticateReqKind, r.Version, r.CorrelationID, r.ClientID)
+	if IsFlexible(SaslAuthenticateReqKind, r.Version) {
+		// Flexible requests carry their own tagged-fields section right
+		// after the header, ahead of the body.
+		TaggedFields(nil).WriteTo(&buf)
+	}
+
+	var body bytes.Buffer
+	if IsFlexible(SaslAuthenticateReqKind, r.Version) {
+		writeCompactBytes(&body, r.AuthBytes)
+		TaggedFields(nil).WriteTo(&body)
+	} else {
+		writeBytes(&body, r.AuthBytes)
+	}
+
+	buf.Write(body.Bytes())
+	return writeFramedMessage(w, buf.Bytes())
+}
+
+// SaslAuthenticateResp carries the broker's half of the exchange, or an
+// error if the client's bytes were rejected.
+type SaslAuthenticateResp struct {
+	ErrorCode         int16
+	ErrorMessage      string
+	AuthBytes         []byte
+	SessionLifetimeMs int64
+}
+
+// ReadSaslAuthenticateResp decodes a SaslAuthenticateResp. version must be
+// the version the request was sent with, since versions >=
+// FlexibleVersions[SaslAuthenticateReqKind] switch to KIP-482 flexible
+// encoding for the whole response.
+func ReadSaslAuthenticateResp(r io.Reader, version int16) (*SaslAuthenticateResp, error) {
+	if IsFlexible(SaslAuthenticateReqKind, version) {
+		return readFlexibleSaslAuthenticateResp(r)
+	}
+
+	dec := newRespDecoder(r)
+	resp := &SaslAuthenticateResp{}
+	if err := binary.Read(dec, binary.BigEndian, &resp.ErrorCode); err != nil {
+		return nil, err
+	}
+	msg, err := readNullableString(dec)
+	if err != nil {
+		return nil, err
+	}
+	resp.ErrorMessage = msg
+	b, err := readBytes(dec)
+	if err != nil {
+		return nil, err
+	}
+	resp.AuthBytes = b
+	// SessionLifetimeMs is only present on newer broker versions; a short
+	// read here is ignored because it is informational only and unused by
+	// the current client.
+	_ = binary.Read(dec, binary.BigEndian, &resp.SessionLifetimeMs)
+	return resp, nil
+}
+
+func readFlexibleSaslAuthenticateResp(r io.Reader) (*SaslAuthenticateResp, error) {
+	br := bufio.NewReader(r)
+	resp := &SaslAuthenticateResp{}
+
+	// The flexible response header's own tagged-fields section sits ahead
+	// of the body and is not stripped by the generic response reader,
+	// which has no notion of per-API flexible versioning.
+	if _, err := readTaggedFields(br); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if resp.ErrorCode, err = readInt16(br); err != nil {
+		return nil, err
+	}
+	msg, err := readCompactNullableString(br)
+	if err != nil {
+		return nil, err
+	}
+	if msg != nil {
+		resp.ErrorMessage = *msg
+	}
+	if resp.AuthBytes, err = readCompactBytes(br); err != nil {
+		return nil, err
+	}
+	if resp.SessionLifetimeMs, err = readInt64(br); err != nil {
+		return nil, err
+	}
+	if _, err := readTaggedFields(br); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
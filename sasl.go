@@ -0,0 +1,238 @@
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+// SASL mechanism names as advertised in proto.SaslHandshakeReq.Mechanism.
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+	SASLMechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// SASLConfig configures SASL authentication, performed once per connection
+// immediately after the TCP/TLS dial and before any other request is sent.
+type SASLConfig struct {
+	// Mechanism selects the authentication mechanism and must be one of the
+	// SASLMechanism* constants.
+	Mechanism string
+
+	// Username and Password are used by PLAIN and the SCRAM mechanisms.
+	Username string
+	Password string
+
+	// TokenProvider supplies a fresh bearer token for OAUTHBEARER. It is
+	// called once per connection (and therefore once per reconnect).
+	TokenProvider func() (string, error)
+}
+
+// authenticateSASL drives the handshake and authentication exchange for c
+// using conf, reauthenticating from scratch every time it is called - in
+// particular on every reconnect, since Kafka does not let a SASL session
+// outlive its TCP connection.
+func authenticateSASL(c *connection, conf SASLConfig) error {
+	if _, err := c.SaslHandshake(&proto.SaslHandshakeReq{Mechanism: conf.Mechanism}); err != nil {
+		return fmt.Errorf("sasl handshake: %s", err)
+	}
+
+	switch conf.Mechanism {
+	case SASLMechanismPlain:
+		return saslAuthPlain(c, conf)
+	case SASLMechanismSCRAMSHA256:
+		return saslAuthSCRAM(c, conf, sha256.New, 32)
+	case SASLMechanismSCRAMSHA512:
+		return saslAuthSCRAM(c, conf, sha512.New, 64)
+	case SASLMechanismOAuthBearer:
+		return saslAuthOAuthBearer(c, conf)
+	default:
+		return fmt.Errorf("unsupported SASL mechanism: %q", conf.Mechanism)
+	}
+}
+
+func saslAuthPlain(c *connection, conf SASLConfig) error {
+	// RFC 4616: [authzid] UTF8NUL authcid UTF8NUL passwd
+	authBytes := []byte("\x00" + conf.Username + "\x00" + conf.Password)
+	resp, err := c.SaslAuthenticate(&proto.SaslAuthenticateReq{AuthBytes: authBytes})
+	if err != nil {
+		return fmt.Errorf("sasl authenticate: %s", err)
+	}
+	if resp.ErrorCode != 0 {
+		return fmt.Errorf("sasl authenticate: %s: %s", proto.KafkaError(resp.ErrorCode), resp.ErrorMessage)
+	}
+	return nil
+}
+
+func saslAuthOAuthBearer(c *connection, conf SASLConfig) error {
+	if conf.TokenProvider == nil {
+		return fmt.Errorf("sasl: TokenProvider must be set for %s", SASLMechanismOAuthBearer)
+	}
+	token, err := conf.TokenProvider()
+	if err != nil {
+		return fmt.Errorf("fetch oauth token: %s", err)
+	}
+	authBytes := []byte("n,,\x01auth=Bearer " + token + "\x01\x01")
+	resp, err := c.SaslAuthenticate(&proto.SaslAuthenticateReq{AuthBytes: authBytes})
+	if err != nil {
+		return fmt.Errorf("sasl authenticate: %s", err)
+	}
+	if resp.ErrorCode != 0 {
+		return fmt.Errorf("sasl authenticate: %s: %s", proto.KafkaError(resp.ErrorCode), resp.ErrorMessage)
+	}
+	return nil
+}
+
+// saslAuthSCRAM runs the SCRAM client-first/server-first/client-final/
+// server-final exchange described in RFC 5802, using hashSize-byte digests
+// produced by newHash (sha256.New for SCRAM-SHA-256, sha512.New for
+// SCRAM-SHA-512).
+func saslAuthSCRAM(c *connection, conf SASLConfig, newHash func() hash.Hash, hashSize int) error {
+	nonce, err := randomNonce(24)
+	if err != nil {
+		return fmt.Errorf("generate client nonce: %s", err)
+	}
+
+	clientFirstBare := "n=" + saslEscape(conf.Username) + ",r=" + nonce
+	clientFirstMsg := "n,," + clientFirstBare
+
+	resp, err := c.SaslAuthenticate(&proto.SaslAuthenticateReq{AuthBytes: []byte(clientFirstMsg)})
+	if err != nil {
+		return fmt.Errorf("sasl authenticate (client-first): %s", err)
+	}
+	if resp.ErrorCode != 0 {
+		return fmt.Errorf("sasl authenticate (client-first): %s: %s", proto.KafkaError(resp.ErrorCode), resp.ErrorMessage)
+	}
+
+	serverFirst := string(resp.AuthBytes)
+	serverNonce, salt, iterations, err := parseSCRAMServerFirst(serverFirst)
+	if err != nil {
+		return fmt.Errorf("parse server-first message: %s", err)
+	}
+	if !strings.HasPrefix(serverNonce, nonce) {
+		return fmt.Errorf("server nonce does not extend client nonce")
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(conf.Password), salt, iterations, hashSize, newHash)
+	clientKey := hmacSum(newHash, saltedPassword, []byte("Client Key"))
+	storedKey := hashSum(newHash, clientKey)
+
+	channelBinding := "c=" + b64(""+"n,,")
+	clientFinalWithoutProof := channelBinding + ",r=" + serverNonce
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+
+	clientSignature := hmacSum(newHash, storedKey, []byte(authMessage))
+	clientProof := xorBytes(clientKey, clientSignature)
+
+	clientFinalMsg := clientFinalWithoutProof + ",p=" + b64(string(clientProof))
+
+	finalResp, err := c.SaslAuthenticate(&proto.SaslAuthenticateReq{AuthBytes: []byte(clientFinalMsg)})
+	if err != nil {
+		return fmt.Errorf("sasl authenticate (client-final): %s", err)
+	}
+	if finalResp.ErrorCode != 0 {
+		return fmt.Errorf("sasl authenticate (client-final): %s: %s", proto.KafkaError(finalResp.ErrorCode), finalResp.ErrorMessage)
+	}
+
+	serverKey := hmacSum(newHash, saltedPassword, []byte("Server Key"))
+	expectedServerSignature := hmacSum(newHash, serverKey, []byte(authMessage))
+	gotServerSignature, err := parseSCRAMServerFinal(string(finalResp.AuthBytes))
+	if err != nil {
+		return fmt.Errorf("parse server-final message: %s", err)
+	}
+	if !hmac.Equal(gotServerSignature, expectedServerSignature) {
+		return fmt.Errorf("server signature mismatch: broker may be impersonated")
+	}
+	return nil
+}
+
+func hmacSum(newHash func() hash.Hash, key, data []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hashSum(newHash func() hash.Hash, data []byte) []byte {
+	h := newHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// saslEscape escapes ',' and '=' as required for the "=2C"/"=3D" SCRAM
+// username encoding (RFC 5802 section 5.1).
+func saslEscape(s string) string {
+	s = strings.ReplaceAll(s, "=", "=3D")
+	s = strings.ReplaceAll(s, ",", "=2C")
+	return s
+}
+
+// parseSCRAMServerFirst parses a "r=...,s=...,i=..." server-first message.
+func parseSCRAMServerFirst(msg string) (nonce string, salt []byte, iterations int, err error) {
+	for _, field := range strings.Split(msg, ",") {
+		switch {
+		case strings.HasPrefix(field, "r="):
+			nonce = field[2:]
+		case strings.HasPrefix(field, "s="):
+			salt, err = b64decode(field[2:])
+			if err != nil {
+				return "", nil, 0, fmt.Errorf("decode salt: %s", err)
+			}
+		case strings.HasPrefix(field, "i="):
+			iterations, err = strconv.Atoi(field[2:])
+			if err != nil {
+				return "", nil, 0, fmt.Errorf("parse iteration count: %s", err)
+			}
+		}
+	}
+	if nonce == "" || salt == nil || iterations == 0 {
+		return "", nil, 0, fmt.Errorf("malformed server-first message: %q", msg)
+	}
+	return nonce, salt, iterations, nil
+}
+
+// parseSCRAMServerFinal parses a "v=..." server-final message into the
+// raw ServerSignature bytes.
+func parseSCRAMServerFinal(msg string) ([]byte, error) {
+	if !strings.HasPrefix(msg, "v=") {
+		return nil, fmt.Errorf("malformed server-final message: %q", msg)
+	}
+	return b64decode(msg[2:])
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b64decode(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// randomNonce returns a base64-encoded cryptographically random client
+// nonce, n raw bytes before encoding.
+func randomNonce(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
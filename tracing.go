@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+// Span represents a single traced unit of work covering one Kafka RPC, from
+// the moment the request is written to the wire to the moment its response
+// (or error) is received. Implementations are provided by a Tracer and must
+// be safe to call from a single goroutine - connection methods never share
+// a Span across goroutines.
+type Span interface {
+	// SetTag attaches a key/value pair describing the traced RPC, e.g.
+	// "kafka.api_key", "kafka.correlation_id", "net.peer.addr".
+	SetTag(key string, value interface{})
+
+	// Finish closes the span. err, when non-nil, marks the span as failed
+	// and should be recorded by the implementation (e.g. as a log field or
+	// an error tag).
+	Finish(err error)
+}
+
+// Tracer starts a Span for a single Kafka request/response round trip.
+// Implementations wrap a specific tracing library (OpenTracing,
+// OpenTelemetry, ...) behind this interface so the driver itself does not
+// depend on one.
+type Tracer interface {
+	// StartSpan starts and returns a new Span as a child of any span found
+	// in ctx, named after the given operation (e.g. "kafka.produce").
+	StartSpan(ctx context.Context, operationName string) Span
+}
+
+// noopTracer is the default Tracer used by a connection until one is
+// explicitly configured. All of its spans are no-ops, so instrumentation
+// costs nothing on the hot path when tracing is not in use.
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, operationName string) Span { return noopSpan{} }
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) Finish(err error)                     {}
+
+// SetTracer configures the Tracer used to instrument every request made
+// through this connection. Passing nil restores the no-op tracer.
+func (c *connection) SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	c.mu.Lock()
+	c.tracer = t
+	c.mu.Unlock()
+}
+
+// startSpan starts a span for the given API call and tags it with the
+// correlation ID and peer address, which are known before the request is
+// even written to the wire, plus any request-specific tags (e.g.
+// "kafka.topics", "kafka.partition_count") the caller already knows at this
+// point.
+func (c *connection) startSpan(ctx context.Context, operationName string, apiKey, apiVersion int16, correlationID int32, tags map[string]interface{}) Span {
+	c.mu.Lock()
+	tracer := c.tracer
+	c.mu.Unlock()
+
+	span := tracer.StartSpan(ctx, operationName)
+	span.SetTag("kafka.api_key", apiKey)
+	span.SetTag("kafka.api_version", apiVersion)
+	span.SetTag("kafka.correlation_id", correlationID)
+	span.SetTag("net.peer.addr", c.rw.RemoteAddr().String())
+	for k, v := range tags {
+		span.SetTag(k, v)
+	}
+	return span
+}
+
+// injectProduceTrace writes the active span's trace context into the
+// headers of every message in req, on protocol versions that support
+// message headers, so that downstream consumers can continue the trace.
+// It is a no-op when the negotiated version predates header support or no
+// tracer is configured.
+func injectProduceTrace(ctx context.Context, tracer Tracer, req *proto.ProduceReq) {
+	if req.Version < proto.KafkaV2 {
+		return
+	}
+	injector, ok := tracer.(interface {
+		Inject(ctx context.Context, headers *[]proto.RecordHeader)
+	})
+	if !ok {
+		return
+	}
+	for ti := range req.Topics {
+		for pi := range req.Topics[ti].Partitions {
+			msgs := req.Topics[ti].Partitions[pi].Messages
+			for mi := range msgs {
+				injector.Inject(ctx, &msgs[mi].Headers)
+			}
+		}
+	}
+}
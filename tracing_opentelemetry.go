@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+// OpenTelemetryTracer adapts an existing trace.Tracer so it can be used as a
+// connection's Tracer. ctx is passed through to Tracer.Start unmodified, so
+// a span already present in ctx becomes the new span's parent.
+type OpenTelemetryTracer struct {
+	Tracer trace.Tracer
+}
+
+// StartSpan implements Tracer.
+func (t OpenTelemetryTracer) StartSpan(ctx context.Context, operationName string) Span {
+	_, span := t.Tracer.Start(ctx, operationName)
+	return openTelemetrySpan{span}
+}
+
+type openTelemetrySpan struct {
+	span trace.Span
+}
+
+func (s openTelemetrySpan) SetTag(key string, value interface{}) {
+	s.span.SetAttributes(otelAttribute(key, value))
+}
+
+func (s openTelemetrySpan) Finish(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// Inject writes the span context carried by ctx into headers using the
+// globally configured OpenTelemetry propagator (W3C tracecontext by
+// default), so a downstream consumer reading the message can continue the
+// trace. It is a no-op when ctx carries no span context.
+func (t OpenTelemetryTracer) Inject(ctx context.Context, headers *[]proto.RecordHeader) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	carrier := &recordHeaderCarrier{headers: headers}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// recordHeaderCarrier adapts a *[]proto.RecordHeader to
+// propagation.TextMapCarrier so otel propagators can write into it directly.
+type recordHeaderCarrier struct {
+	headers *[]proto.RecordHeader
+}
+
+func (c *recordHeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c *recordHeaderCarrier) Set(key, value string) {
+	*c.headers = append(*c.headers, proto.RecordHeader{Key: key, Value: []byte(value)})
+}
+
+func (c *recordHeaderCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
+
+func otelAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int16:
+		return attribute.Int64(key, int64(v))
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprintf("%v", v))
+	}
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/optiopay/kafka/proto"
+)
+
+// OpenTracingTracer adapts an existing opentracing.Tracer so it can be used
+// as a connection's Tracer. Started spans become children of whatever span
+// opentracing.SpanFromContext finds in ctx, if any.
+type OpenTracingTracer struct {
+	Tracer opentracing.Tracer
+}
+
+// StartSpan implements Tracer.
+func (t OpenTracingTracer) StartSpan(ctx context.Context, operationName string) Span {
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	return openTracingSpan{t.Tracer.StartSpan(operationName, opts...)}
+}
+
+type openTracingSpan struct {
+	span opentracing.Span
+}
+
+func (s openTracingSpan) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+func (s openTracingSpan) Finish(err error) {
+	if err != nil {
+		s.span.SetTag("error", true)
+		s.span.LogKV("event", "error", "message", err.Error())
+	}
+	s.span.Finish()
+}
+
+// Inject writes the span found in ctx into headers using OpenTracing's
+// TextMap carrier format, so a downstream consumer reading the message can
+// continue the trace. It is a no-op when ctx carries no span.
+func (t OpenTracingTracer) Inject(ctx context.Context, headers *[]proto.RecordHeader) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return
+	}
+	carrier.ForeachKey(func(key, val string) error {
+		*headers = append(*headers, proto.RecordHeader{Key: key, Value: []byte(val)})
+		return nil
+	})
+}